@@ -4,12 +4,10 @@
 package conf
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/xml"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,10 +29,11 @@ type elem struct {
 	name     string
 	value    string
 	children map[string]*elem
+	order    []string // child names in insertion order, since map iteration is randomized
 }
 
 func newElem(kind int, name string) *elem {
-	return &elem{kind, name, "", make(map[string]*elem)}
+	return &elem{kind, name, "", make(map[string]*elem), nil}
 }
 
 func (e *elem) setValue(value string) *elem {
@@ -42,16 +41,59 @@ func (e *elem) setValue(value string) *elem {
 	return e
 }
 
+// addChild adds or replaces the child named name, preserving its original
+// insertion position when replacing.
 func (e *elem) addChild(name string, child *elem) *elem {
+	if _, exists := e.children[name]; !exists {
+		e.order = append(e.order, name)
+	}
 	e.children[name] = child
 	return e
 }
 
+// removeChild removes the child named name, reporting whether it existed.
+func (e *elem) removeChild(name string) bool {
+	if _, ok := e.children[name]; !ok {
+		return false
+	}
+	delete(e.children, name)
+	for i, n := range e.order {
+		if n == name {
+			e.order = append(e.order[:i], e.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
 func (e *elem) findChild(name string) (ret *elem, ok bool) {
 	ret, ok = e.children[name]
 	return
 }
 
+// eachChild calls fn for each child in insertion order.
+func (e *elem) eachChild(fn func(*elem)) {
+	for _, name := range e.order {
+		fn(e.children[name])
+	}
+}
+
+// ensureNode walks names from e, creating intermediate nodes as needed, and
+// returns the final node. An existing non-node child in the path is
+// replaced with a node so the path can still be created.
+func (e *elem) ensureNode(names []string) *elem {
+	cur := e
+	for _, name := range names {
+		child, ok := cur.findChild(name)
+		if !ok || !child.isNode() {
+			child = newElem(Node, name)
+			cur.addChild(name, child)
+		}
+		cur = child
+	}
+	return cur
+}
+
 func (e *elem) isNode() bool {
 	return e.kind == Node
 }
@@ -65,9 +107,9 @@ func (e *elem) toString(h int) string {
 		return fmt.Sprintf("\n%s%s:%s", strings.Repeat("\t", h), e.name, e.value)
 	}
 	ret := fmt.Sprintf("\n%s%s:", strings.Repeat("\t", h), e.name)
-	for _, child := range e.children {
+	e.eachChild(func(child *elem) {
 		ret += child.toString(h + 1)
-	}
+	})
 	return ret
 }
 
@@ -111,11 +153,11 @@ func (e *elem) getDomain(path string) ([]string, error) {
 	if err != nil {
 		return domain, err
 	}
-	for _, child := range targetNode.children {
+	targetNode.eachChild(func(child *elem) {
 		if child.isNode() {
 			domain = append(domain, child.name)
 		}
-	}
+	})
 	return domain, nil
 }
 
@@ -126,11 +168,11 @@ func (e *elem) getMap(path string) (map[string]string, error) {
 	if err != nil {
 		return kvMap, nil
 	}
-	for _, child := range targetNode.children {
+	targetNode.eachChild(func(child *elem) {
 		if child.isLeaf() {
 			kvMap[child.name] = child.value
 		}
-	}
+	})
 	return kvMap, nil
 }
 
@@ -144,21 +186,115 @@ func (e *elem) getValue(path string) (string, error) {
 	return targetNode.value, nil
 }
 
+const (
+	// defaultMaxDepth is the default ceiling on nested element depth.
+	defaultMaxDepth = 10000
+	// defaultMaxElements is the default ceiling on the total number of nodes+leaves parsed.
+	defaultMaxElements = 1000000
+	// defaultMaxLeavesPerNode is the default ceiling on key=value leaves under a single node.
+	defaultMaxLeavesPerNode = 100000
+	// defaultMaxIncludeDepth is the default ceiling on nested include chains.
+	defaultMaxIncludeDepth = 16
+)
+
+// ParseError describes why InitFromBytes rejected a config, naming the
+// offending tag, the byte offset it was found at, and which limit was hit.
+type ParseError struct {
+	Tag      string // offending tag name, if applicable
+	Expected string // expected tag name, for mismatched end elements
+	Offset   int64  // byte offset into the input, from xml.Decoder.InputOffset
+	Limit    string // name of the limit that was exceeded, e.g. "MaxDepth"
+}
+
+func (e *ParseError) Error() string {
+	if e.Expected != "" {
+		return fmt.Sprintf("xml end tag mismatch: expected %q got %q at offset %d", e.Expected, e.Tag, e.Offset)
+	}
+	return fmt.Sprintf("%s exceeded at tag %q, offset %d", e.Limit, e.Tag, e.Offset)
+}
+
 // Conf struct for parse xml-like tars config file.
 type Conf struct {
-	content []byte        // content for storing data
-	mutex   *sync.RWMutex // mutex for multi goroutines
-	root    *elem         // root is the root element
+	content  []byte        // content for storing data
+	mutex    *sync.RWMutex // mutex for multi goroutines
+	root     *elem         // root is the root element
+	fileName string        // fileName is the source file last loaded via InitFromFile, if any
+
+	maxDepth         int // max nesting depth allowed while parsing
+	maxElements      int // max total nodes+leaves allowed while parsing
+	maxLeavesPerNode int // max key=value leaves allowed under a single node
+	maxSize          int // max size in bytes allowed for InitFromBytes input, 0 means unlimited
+
+	format Format // format selects which parser InitFromBytes uses, TAF by default
+
+	vars            map[string]string // SetVars overrides for ${VAR} expansion, checked before os.Environ
+	maxIncludeDepth int               // ceiling on nested !include / include: chains
+
+	subMutex  *sync.Mutex                        // subMutex guards subs and nextSubID
+	subs      map[int]func(old *Conf, new *Conf) // OnChange subscribers keyed by subscription id
+	nextSubID int
+}
+
+// Option configures a Conf returned by New.
+type Option func(*Conf)
+
+// WithMaxDepth caps how deeply nested elements may be before InitFromBytes
+// rejects the input with a *ParseError.
+func WithMaxDepth(n int) Option {
+	return func(c *Conf) { c.maxDepth = n }
 }
 
-// New  returns an new Conf struct.
-func New() *Conf {
-	return &Conf{[]byte{}, new(sync.RWMutex), newElem(Node, "root")}
+// WithMaxElements caps the total number of nodes and leaves InitFromBytes
+// will create before rejecting the input with a *ParseError.
+func WithMaxElements(n int) Option {
+	return func(c *Conf) { c.maxElements = n }
+}
+
+// WithMaxLeavesPerNode caps the number of key=value leaves allowed directly
+// under a single node before InitFromBytes rejects the input.
+func WithMaxLeavesPerNode(n int) Option {
+	return func(c *Conf) { c.maxLeavesPerNode = n }
+}
+
+// WithMaxSize rejects input whose length exceeds n bytes before decoding
+// even begins. n <= 0 disables the check.
+func WithMaxSize(n int) Option {
+	return func(c *Conf) { c.maxSize = n }
+}
+
+// WithFormat selects which parser InitFromBytes uses instead of inferring
+// it from a file extension. See NewConfFromFile.
+func WithFormat(f Format) Option {
+	return func(c *Conf) { c.format = f }
+}
+
+// WithMaxIncludeDepth caps how many levels of nested !include / include:
+// directives the TAF parser will follow before rejecting the input.
+func WithMaxIncludeDepth(n int) Option {
+	return func(c *Conf) { c.maxIncludeDepth = n }
+}
+
+// New returns a new Conf struct, applying any Options given.
+func New(opts ...Option) *Conf {
+	c := &Conf{
+		content:          []byte{},
+		mutex:            new(sync.RWMutex),
+		root:             newElem(Node, "root"),
+		subMutex:         new(sync.Mutex),
+		maxDepth:         defaultMaxDepth,
+		maxElements:      defaultMaxElements,
+		maxLeavesPerNode: defaultMaxLeavesPerNode,
+		maxIncludeDepth:  defaultMaxIncludeDepth,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // NewConf returns a new Conf with the fileName
-func NewConf(fileName string) (*Conf, error) {
-	c := &Conf{[]byte{}, new(sync.RWMutex), newElem(Node, "root")}
+func NewConf(fileName string, opts ...Option) (*Conf, error) {
+	c := New(opts...)
 	if err := c.InitFromFile(fileName); err != nil {
 		return nil, err
 	}
@@ -171,7 +307,17 @@ func (c *Conf) InitFromFile(fileName string) error {
 	if err != nil {
 		return fmt.Errorf("read file %s error:%v", fileName, err)
 	}
-	return c.InitFromBytes(content)
+	absFileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return fmt.Errorf("resolve file %s error:%v", fileName, err)
+	}
+	if err := c.initFromBytes(content, filepath.Dir(absFileName), absFileName); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.fileName = fileName
+	c.mutex.Unlock()
+	return nil
 }
 
 // InitFromString returns error when init config from a string
@@ -179,60 +325,39 @@ func (c *Conf) InitFromString(content string) error {
 	return c.InitFromBytes(([]byte)(content))
 }
 
-// InitFromBytes returns error when init config from bytes
+// InitFromBytes returns error when init config from bytes. The bytes are
+// decoded by whichever parser matches c's format (TAF by default, see
+// WithFormat), and the tree is only swapped in once that parser succeeds.
+// Relative !include paths resolve against the current working directory;
+// use InitFromFile when they should resolve relative to a source file.
 func (c *Conf) InitFromBytes(content []byte) error {
+	return c.initFromBytes(content, "", "")
+}
+
+func (c *Conf) initFromBytes(content []byte, baseDir, selfPath string) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.content = content
-	xmlDecoder := xml.NewDecoder(bytes.NewReader(c.content))
-	var nodeStack []*elem
-	nodeStack = append(nodeStack, c.root)
-	for {
-		currNode := nodeStack[len(nodeStack)-1]
-		token, _ := xmlDecoder.Token()
-		if token == nil {
-			break
-		}
-		switch t := token.(type) {
-		case xml.CharData:
-			lineDecoder := bufio.NewScanner(bytes.NewReader(t))
-			lineDecoder.Split(bufio.ScanLines)
-			for lineDecoder.Scan() {
-				line := strings.Trim(lineDecoder.Text(), whiteSpaceChars)
-				if len(line) > 0 && line[0] == '#' {
-					continue
-				}
-				kv := strings.SplitN(line, "=", 2)
-				if len(kv) != 2 {
-					continue
-				}
-				k, v := strings.Trim(kv[0], whiteSpaceChars), strings.Trim(kv[1], whiteSpaceChars)
-				if k == "" {
-					continue
-				}
-				leaf := newElem(Leaf, k)
-				leaf.setValue(v)
-				currNode.addChild(k, leaf)
-			}
-		case xml.StartElement:
-			nodeName := t.Name.Local
-			node, ok := currNode.findChild(nodeName)
-			if !ok {
-				node = newElem(Node, nodeName)
-				currNode.addChild(nodeName, node)
-			}
-			nodeStack = append(nodeStack, node)
-		case xml.EndElement:
-			nodeName := t.Name.Local
-			if currNode.name != nodeName {
-				return fmt.Errorf("xml end not match :%s", nodeName)
-			}
-			nodeStack = nodeStack[:len(nodeStack)-1]
-		}
+	if c.maxSize > 0 && len(content) > c.maxSize {
+		return &ParseError{Limit: "MaxSize"}
+	}
+	newRoot, err := c.parserFor(c.format, baseDir, selfPath).parse(content)
+	if err != nil {
+		return err
 	}
+	c.content = content
+	c.root = newRoot
 	return nil
 }
 
+// SetVars installs an override map consulted before os.Environ when
+// expanding ${VAR} / ${VAR:-default} references in leaf values during the
+// next parse. It does not trigger a re-parse by itself.
+func (c *Conf) SetVars(vars map[string]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.vars = vars
+}
+
 // GetStringWithDef returns the value for pointed path, or a default value when error happens
 func (c *Conf) GetStringWithDef(path string, defVal string) string {
 	c.mutex.RLock()
@@ -290,6 +415,8 @@ func (c *Conf) GetMap(path string) map[string]string {
 
 // ToString returns the config as a string
 func (c *Conf) ToString() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	return c.root.toString(0)
 }
 
@@ -0,0 +1,92 @@
+package conf
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestInitFromBytesRejectsDeepNesting proves a deeply nested document past
+// MaxDepth is rejected with a typed *ParseError rather than growing the
+// parser's node stack without bound.
+func TestInitFromBytesRejectsDeepNesting(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 50000; i++ {
+		b.WriteString("<a>")
+	}
+	for i := 0; i < 50000; i++ {
+		b.WriteString("</a>")
+	}
+
+	c := New(WithMaxDepth(10000))
+	err := c.InitFromString(b.String())
+	if err == nil {
+		t.Fatal("InitFromString: expected MaxDepth to reject a 50000-deep document, got nil error")
+	}
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Limit != "MaxDepth" {
+		t.Fatalf("InitFromString: expected a MaxDepth ParseError, got %#v", err)
+	}
+}
+
+// TestInitFromBytesRejectsHighBranching proves a document with many
+// sibling leaves under one node past MaxLeavesPerNode is rejected rather
+// than growing that node's child map without bound.
+func TestInitFromBytesRejectsHighBranching(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("<a>\n")
+	for i := 0; i < 200000; i++ {
+		b.WriteString("k" + strconv.Itoa(i) + "=v\n")
+	}
+	b.WriteString("</a>\n")
+
+	c := New(WithMaxLeavesPerNode(100000))
+	err := c.InitFromString(b.String())
+	if err == nil {
+		t.Fatal("InitFromString: expected MaxLeavesPerNode to reject 200000 sibling leaves, got nil error")
+	}
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Limit != "MaxLeavesPerNode" {
+		t.Fatalf("InitFromString: expected a MaxLeavesPerNode ParseError, got %#v", err)
+	}
+}
+
+// TestInitFromBytesRejectsTooManyElements proves a wide document with many
+// sibling start tags (rather than leaves under one node) is rejected by
+// MaxElements, which counts every start tag even when siblings share a name.
+func TestInitFromBytesRejectsTooManyElements(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("<a>\n")
+	for i := 0; i < 5000; i++ {
+		b.WriteString("<b><c></c></b>\n")
+	}
+	b.WriteString("</a>\n")
+
+	c := New(WithMaxElements(1000))
+	err := c.InitFromString(b.String())
+	if err == nil {
+		t.Fatal("InitFromString: expected MaxElements to reject, got nil error")
+	}
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Limit != "MaxElements" {
+		t.Fatalf("InitFromString: expected a MaxElements ParseError, got %#v", err)
+	}
+}
+
+// FuzzInitFromBytes feeds arbitrary, including deeply nested and highly
+// branching, byte sequences into InitFromBytes and asserts it always
+// returns cleanly (an error or success) rather than panicking or hanging,
+// regardless of the configured limits.
+func FuzzInitFromBytes(f *testing.F) {
+	f.Add([]byte("<tars>\n\ta=1\n</tars>\n"))
+	f.Add([]byte(strings.Repeat("<a>", 2000) + strings.Repeat("</a>", 2000)))
+	f.Add([]byte("<a>\n" + strings.Repeat("k=v\n", 5000) + "</a>\n"))
+	f.Add([]byte("<a><b></a></b>"))
+	f.Add([]byte(""))
+	f.Add([]byte("!include does-not-exist.conf"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := New(WithMaxDepth(1000), WithMaxElements(100000), WithMaxLeavesPerNode(10000))
+		_ = c.InitFromBytes(data)
+	})
+}
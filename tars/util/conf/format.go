@@ -0,0 +1,403 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format selects which parser InitFromBytes uses to build the Conf tree.
+type Format int
+
+const (
+	// FormatTAF is the legacy XML-with-key=value-leaves hybrid format.
+	FormatTAF Format = iota
+	// FormatJSON parses the content as JSON.
+	FormatJSON
+	// FormatYAML parses the content as YAML.
+	FormatYAML
+	// FormatTOML parses the content as TOML.
+	FormatTOML
+)
+
+// parser turns raw config bytes into a *elem tree rooted at a synthetic
+// "root" node, the same shape InitFromBytes has always produced for TAF.
+type parser interface {
+	parse(content []byte) (*elem, error)
+}
+
+// parserFor returns the parser for f, defaulting to the TAF hybrid parser
+// for any unrecognized or zero-value Format.
+func (c *Conf) parserFor(f Format, baseDir, selfPath string) parser {
+	switch f {
+	case FormatJSON:
+		return jsonParser{}
+	case FormatYAML:
+		return yamlParser{}
+	case FormatTOML:
+		return tomlParser{}
+	default:
+		visited := make(map[string]bool)
+		if selfPath != "" {
+			visited[selfPath] = true
+		}
+		return &tafParser{
+			budget: &parseBudget{
+				maxDepth:         c.maxDepth,
+				maxElements:      c.maxElements,
+				maxLeavesPerNode: c.maxLeavesPerNode,
+				leafCount:        make(map[*elem]int),
+			},
+			baseDir:         baseDir,
+			vars:            c.vars,
+			maxIncludeDepth: c.maxIncludeDepth,
+			visited:         visited,
+		}
+	}
+}
+
+// NewConfFromFile returns a new Conf loaded from fileName, selecting a
+// parser by its extension (.json, .yaml/.yml, .toml, anything else is
+// treated as TAF) unless overridden with an explicit WithFormat option.
+// Every existing GetString/GetInt/GetMap/GetDomain call site keeps working
+// unchanged regardless of the backing format, since all parsers build the
+// same Node/Leaf tree.
+func NewConfFromFile(fileName string, opts ...Option) (*Conf, error) {
+	allOpts := append([]Option{WithFormat(formatFromExt(fileName))}, opts...)
+	return NewConf(fileName, allOpts...)
+}
+
+func formatFromExt(fileName string) Format {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatTAF
+	}
+}
+
+// parseBudget tracks the limits from WithMaxDepth/WithMaxElements/
+// WithMaxLeavesPerNode and is shared, by pointer, across a tafParser and
+// every child tafParser spawned for its !include'd files, so the limits
+// bound the whole assembled document rather than resetting per file.
+type parseBudget struct {
+	maxDepth         int
+	maxElements      int
+	maxLeavesPerNode int
+	elementCount     int
+	leafCount        map[*elem]int
+}
+
+// tafParser is the original XML-with-key=value-leaves hybrid parser,
+// bounded by the limits described on Conf (see WithMaxDepth and friends).
+type tafParser struct {
+	budget    *parseBudget
+	baseDepth int // nesting depth of the node this parser's output is grafted under
+
+	baseDir         string            // directory include paths resolve against
+	vars            map[string]string // SetVars overrides, checked before os.Environ
+	maxIncludeDepth int               // ceiling on nested !include / include: chains
+	includeDepth    int               // current depth in that chain
+	visited         map[string]bool   // absolute paths of files on the current include chain, for cycle detection
+}
+
+func (p *tafParser) parse(content []byte) (*elem, error) {
+	newRoot := newElem(Node, "root")
+	xmlDecoder := xml.NewDecoder(bytes.NewReader(content))
+	nodeStack := []*elem{newRoot}
+	for {
+		currNode := nodeStack[len(nodeStack)-1]
+		// RawToken rather than Token: Token rejects a mismatched end tag
+		// itself, which would end the loop before the check below.
+		token, _ := xmlDecoder.RawToken()
+		if token == nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			lineDecoder := bufio.NewScanner(bytes.NewReader(t))
+			lineDecoder.Split(bufio.ScanLines)
+			for lineDecoder.Scan() {
+				line := strings.Trim(lineDecoder.Text(), whiteSpaceChars)
+				if len(line) > 0 && line[0] == '#' {
+					continue
+				}
+				if strings.HasPrefix(line, "!include ") {
+					includePath := strings.Trim(strings.TrimPrefix(line, "!include "), whiteSpaceChars)
+					if err := p.include(currNode, includePath, p.baseDepth+len(nodeStack)); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				kv := strings.SplitN(line, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				k, v := strings.Trim(kv[0], whiteSpaceChars), strings.Trim(kv[1], whiteSpaceChars)
+				if k == "" {
+					continue
+				}
+				v = expandVars(v, p.vars)
+				if p.budget.leafCount[currNode] >= p.budget.maxLeavesPerNode {
+					return nil, &ParseError{Tag: k, Offset: xmlDecoder.InputOffset(), Limit: "MaxLeavesPerNode"}
+				}
+				p.budget.elementCount++
+				if p.budget.elementCount > p.budget.maxElements {
+					return nil, &ParseError{Tag: k, Offset: xmlDecoder.InputOffset(), Limit: "MaxElements"}
+				}
+				leaf := newElem(Leaf, k)
+				leaf.setValue(v)
+				currNode.addChild(k, leaf)
+				p.budget.leafCount[currNode]++
+			}
+		case xml.StartElement:
+			nodeName := t.Name.Local
+			if p.baseDepth+len(nodeStack) >= p.budget.maxDepth {
+				return nil, &ParseError{Tag: nodeName, Offset: xmlDecoder.InputOffset(), Limit: "MaxDepth"}
+			}
+			p.budget.elementCount++
+			if p.budget.elementCount > p.budget.maxElements {
+				return nil, &ParseError{Tag: nodeName, Offset: xmlDecoder.InputOffset(), Limit: "MaxElements"}
+			}
+			node, ok := currNode.findChild(nodeName)
+			if !ok {
+				node = newElem(Node, nodeName)
+				currNode.addChild(nodeName, node)
+			}
+			nodeStack = append(nodeStack, node)
+		case xml.Comment:
+			text := strings.TrimSpace(string(t))
+			if rest := strings.TrimPrefix(text, "include:"); rest != text {
+				if err := p.include(currNode, strings.TrimSpace(rest), p.baseDepth+len(nodeStack)); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			nodeName := t.Name.Local
+			if len(nodeStack) == 1 {
+				return nil, fmt.Errorf("conf: unexpected end tag %q at offset %d", nodeName, xmlDecoder.InputOffset())
+			}
+			if currNode.name != nodeName {
+				return nil, &ParseError{Tag: nodeName, Expected: currNode.name, Offset: xmlDecoder.InputOffset()}
+			}
+			nodeStack = nodeStack[:len(nodeStack)-1]
+		}
+	}
+	return newRoot, nil
+}
+
+// include parses includePath (resolved against p.baseDir if relative) and
+// grafts its root children under target, guarding against include cycles
+// and excessive nesting. depth is how deeply target is already nested in
+// the overall document, so MaxDepth applies across the whole include tree
+// rather than resetting for each included file; budget is shared the same
+// way so MaxElements/MaxLeavesPerNode do too.
+func (p *tafParser) include(target *elem, includePath string, depth int) error {
+	if includePath == "" {
+		return fmt.Errorf("conf: empty include path")
+	}
+	resolved := includePath
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(p.baseDir, resolved)
+	}
+	abs, err := filepath.Abs(resolved)
+	if err != nil {
+		return fmt.Errorf("conf: resolve include %q: %v", includePath, err)
+	}
+	if p.includeDepth+1 > p.maxIncludeDepth {
+		return fmt.Errorf("conf: include depth exceeds MaxIncludeDepth (%d) at %s", p.maxIncludeDepth, abs)
+	}
+	if p.visited[abs] {
+		return fmt.Errorf("conf: include cycle detected at %s", abs)
+	}
+	content, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return fmt.Errorf("conf: read include %s: %v", abs, err)
+	}
+
+	visited := make(map[string]bool, len(p.visited)+1)
+	for k := range p.visited {
+		visited[k] = true
+	}
+	visited[abs] = true
+	child := &tafParser{
+		budget:          p.budget,
+		baseDepth:       depth - 1, // the included root stands for target, already counted in depth
+		baseDir:         filepath.Dir(abs),
+		vars:            p.vars,
+		maxIncludeDepth: p.maxIncludeDepth,
+		includeDepth:    p.includeDepth + 1,
+		visited:         visited,
+	}
+	includedRoot, err := child.parse(content)
+	if err != nil {
+		return err
+	}
+	includedRoot.eachChild(func(c *elem) {
+		target.addChild(c.name, c)
+	})
+	return nil
+}
+
+// envVarPattern matches ${VAR} and ${VAR:-default} references.
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandVars resolves ${VAR} / ${VAR:-default} references in s against
+// overrides first, then os.Environ, leaving unresolved references with no
+// default as an empty string.
+func expandVars(s string, overrides map[string]string) string {
+	return envVarPattern.ReplaceAllStringFunc(s, func(match string) string {
+		sub := envVarPattern.FindStringSubmatch(match)
+		name, defPart := sub[1], sub[2]
+		if v, ok := overrides[name]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		if strings.HasPrefix(defPart, ":-") {
+			return defPart[2:]
+		}
+		return ""
+	})
+}
+
+type jsonParser struct{}
+
+func (jsonParser) parse(content []byte) (*elem, error) {
+	var raw interface{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("conf: parse json: %v", err)
+	}
+	return rootFromGoValue(raw)
+}
+
+type yamlParser struct{}
+
+func (yamlParser) parse(content []byte) (*elem, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("conf: parse yaml: %v", err)
+	}
+	return rootFromGoValue(raw)
+}
+
+type tomlParser struct{}
+
+func (tomlParser) parse(content []byte) (*elem, error) {
+	var raw map[string]interface{}
+	if err := toml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("conf: parse toml: %v", err)
+	}
+	return rootFromGoValue(raw)
+}
+
+// rootFromGoValue builds the synthetic "root" node from a decoded
+// map[string]interface{} document. JSON, YAML and TOML all decode a
+// top-level object/mapping into this shape.
+func rootFromGoValue(raw interface{}) (*elem, error) {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("conf: document root must be an object/mapping, got %T", raw)
+	}
+	root := newElem(Node, "root")
+	for _, k := range sortedKeys(m) {
+		root.addChild(k, elemFromGoValue(k, m[k]))
+	}
+	return root, nil
+}
+
+// elemFromGoValue converts a single decoded value into an elem named name.
+// Nested objects become Node elems, scalars become Leaf elems holding the
+// strconv-style string form of the value, arrays of scalars are exposed
+// through GetDomain (each item becomes a Node child keyed by its index, so
+// repeated values don't collide, but named after its own string value so
+// GetDomain's name list still surfaces the values) and arrays of objects
+// become numerically-named Node children (0, 1, ...) both keyed and named
+// by index, keeping the existing /A/B/C<key> path syntax uniform across
+// every format.
+func elemFromGoValue(name string, v interface{}) *elem {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		node := newElem(Node, name)
+		for _, k := range sortedKeys(val) {
+			node.addChild(k, elemFromGoValue(k, val[k]))
+		}
+		return node
+	case []interface{}:
+		node := newElem(Node, name)
+		if isScalarArray(val) {
+			for i, item := range val {
+				idx := strconv.Itoa(i)
+				node.addChild(idx, newElem(Node, scalarToString(item)))
+			}
+			return node
+		}
+		for i, item := range val {
+			idx := strconv.Itoa(i)
+			node.addChild(idx, elemFromGoValue(idx, item))
+		}
+		return node
+	default:
+		leaf := newElem(Leaf, name)
+		leaf.setValue(scalarToString(v))
+		return leaf
+	}
+}
+
+// isScalarArray reports whether every item of val is a scalar (as opposed
+// to an object or nested array), which decides whether the array is
+// exposed through GetDomain or through numerically-named child nodes.
+func isScalarArray(val []interface{}) bool {
+	for _, item := range val {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func scalarToString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
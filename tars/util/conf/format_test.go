@@ -0,0 +1,232 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExpandVarsPrefersSetVarsOverEnviron proves ${VAR} is resolved from
+// Conf.SetVars before falling back to the process environment, and that
+// ${VAR:-default} is honored when VAR is set in neither.
+func TestExpandVarsPrefersSetVarsOverEnviron(t *testing.T) {
+	t.Setenv("CONF_TEST_HOST", "from-environ")
+
+	c := New()
+	c.SetVars(map[string]string{"CONF_TEST_HOST": "from-setvars"})
+	content := "<tars>\n\thost=${CONF_TEST_HOST}\n\tport=${CONF_TEST_PORT:-8080}\n</tars>\n"
+	if err := c.InitFromString(content); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+	if got := c.GetString("/tars<host>"); got != "from-setvars" {
+		t.Errorf("host = %q, want %q (SetVars should win over os.Environ)", got, "from-setvars")
+	}
+	if got := c.GetString("/tars<port>"); got != "8080" {
+		t.Errorf("port = %q, want %q (default fallback)", got, "8080")
+	}
+}
+
+// TestExpandVarsFallsBackToEnviron proves ${VAR} resolves from the process
+// environment when no SetVars override exists for it.
+func TestExpandVarsFallsBackToEnviron(t *testing.T) {
+	t.Setenv("CONF_TEST_REGION", "us-west")
+
+	c := New()
+	if err := c.InitFromString("<tars>\n\tregion=${CONF_TEST_REGION}\n</tars>\n"); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+	if got := c.GetString("/tars<region>"); got != "us-west" {
+		t.Errorf("region = %q, want %q", got, "us-west")
+	}
+}
+
+// TestIncludeCycleDetected proves a file that (transitively) includes
+// itself is rejected instead of recursing forever.
+func TestIncludeCycleDetected(t *testing.T) {
+	dir := t.TempDir()
+	aPath := filepath.Join(dir, "a.conf")
+	bPath := filepath.Join(dir, "b.conf")
+	if err := os.WriteFile(aPath, []byte("<tars>\n!include b.conf\n</tars>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bPath, []byte("<tars>\n!include a.conf\n</tars>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New()
+	err := c.InitFromFile(aPath)
+	if err == nil {
+		t.Fatal("InitFromFile: expected an include cycle to be rejected, got nil error")
+	}
+	if !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("InitFromFile: expected a cycle-detection error, got %v", err)
+	}
+}
+
+// TestIncludeDepthEnforced proves a chain of !includes deeper than
+// WithMaxIncludeDepth is rejected rather than followed indefinitely.
+func TestIncludeDepthEnforced(t *testing.T) {
+	dir := t.TempDir()
+	const chainLen = 5
+	for i := 0; i < chainLen; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("f%d.conf", i))
+		var body string
+		if i == chainLen-1 {
+			body = "leaf=v\n"
+		} else {
+			body = fmt.Sprintf("!include f%d.conf\n", i+1)
+		}
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mainPath := filepath.Join(dir, "f0.conf")
+
+	c := New(WithMaxIncludeDepth(2))
+	err := c.InitFromFile(mainPath)
+	if err == nil {
+		t.Fatal("InitFromFile: expected MaxIncludeDepth to reject a 5-deep include chain, got nil error")
+	}
+	if !strings.Contains(err.Error(), "MaxIncludeDepth") {
+		t.Errorf("InitFromFile: expected a MaxIncludeDepth error, got %v", err)
+	}
+
+	c2 := New(WithMaxIncludeDepth(chainLen + 1))
+	if err := c2.InitFromFile(mainPath); err != nil {
+		t.Fatalf("InitFromFile: expected a generous include depth to succeed, got %v", err)
+	}
+	if got := c2.GetString("leaf"); got != "v" {
+		t.Errorf("leaf = %q, want %q", got, "v")
+	}
+}
+
+// TestIncludeSharesElementBudget proves that MaxElements bounds the whole
+// assembled document, not just whichever file the limit happens to be
+// checked inside of a single !include.
+func TestIncludeSharesElementBudget(t *testing.T) {
+	dir := t.TempDir()
+
+	var leaves strings.Builder
+	leaves.WriteString("<leafy>\n")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&leaves, "k%d=v\n", i)
+	}
+	leaves.WriteString("</leafy>\n")
+	if err := os.WriteFile(filepath.Join(dir, "leafy.conf"), []byte(leaves.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var main strings.Builder
+	main.WriteString("<main>\n")
+	for i := 0; i < 5; i++ {
+		main.WriteString("!include leafy.conf\n")
+	}
+	main.WriteString("</main>\n")
+	mainPath := filepath.Join(dir, "main.conf")
+	if err := os.WriteFile(mainPath, []byte(main.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(WithMaxElements(100))
+	err := c.InitFromFile(mainPath)
+	if err == nil {
+		t.Fatalf("InitFromFile: expected MaxElements to be exceeded across includes, got nil error")
+	}
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Limit != "MaxElements" {
+		t.Fatalf("InitFromFile: expected a MaxElements ParseError, got %#v", err)
+	}
+
+	c2 := New(WithMaxElements(1000))
+	if err := c2.InitFromFile(mainPath); err != nil {
+		t.Fatalf("InitFromFile: expected a generous budget to succeed, got %v", err)
+	}
+}
+
+// TestIncludeSharesDepthBudget proves that MaxDepth accounts for how deep
+// the include point already is in the outer document, not just the
+// included file's own internal nesting.
+func TestIncludeSharesDepthBudget(t *testing.T) {
+	dir := t.TempDir()
+
+	nested := "<a><b><c>\nleaf=v\n</c></b></a>\n"
+	if err := os.WriteFile(filepath.Join(dir, "nested.conf"), []byte(nested), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	main := "<outer>\n!include nested.conf\n</outer>\n"
+	mainPath := filepath.Join(dir, "main.conf")
+	if err := os.WriteFile(mainPath, []byte(main), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(WithMaxDepth(4))
+	err := c.InitFromFile(mainPath)
+	if err == nil {
+		t.Fatalf("InitFromFile: expected MaxDepth to be exceeded once outer nesting is accounted for, got nil error")
+	}
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Limit != "MaxDepth" {
+		t.Fatalf("InitFromFile: expected a MaxDepth ParseError, got %#v", err)
+	}
+}
+
+// TestScalarArrayExposedThroughGetDomain proves that a JSON/YAML/TOML array
+// of scalars is reachable through GetDomain (named after its own values),
+// while an array of objects keeps the numerically-named child nodes.
+func TestScalarArrayExposedThroughGetDomain(t *testing.T) {
+	c := New(WithFormat(FormatJSON))
+	err := c.InitFromBytes([]byte(`{"a":{"tags":["x","y","z"],"items":[{"id":"1"},{"id":"2"}]}}`))
+	if err != nil {
+		t.Fatalf("InitFromBytes: %v", err)
+	}
+
+	gotTags := c.GetDomain("/a/tags")
+	wantTags := []string{"x", "y", "z"}
+	if len(gotTags) != len(wantTags) {
+		t.Fatalf("GetDomain(/a/tags) = %v, want %v", gotTags, wantTags)
+	}
+	seen := make(map[string]bool)
+	for _, v := range gotTags {
+		seen[v] = true
+	}
+	for _, want := range wantTags {
+		if !seen[want] {
+			t.Errorf("GetDomain(/a/tags) = %v, missing %q", gotTags, want)
+		}
+	}
+
+	gotItems := c.GetDomain("/a/items")
+	wantItems := []string{"0", "1"}
+	if len(gotItems) != len(wantItems) {
+		t.Fatalf("GetDomain(/a/items) = %v, want %v", gotItems, wantItems)
+	}
+	if c.GetString("/a/items/0/id") != "1" || c.GetString("/a/items/1/id") != "2" {
+		t.Errorf("object array items not preserved: items/0/id=%q items/1/id=%q",
+			c.GetString("/a/items/0/id"), c.GetString("/a/items/1/id"))
+	}
+}
+
+// TestScalarArrayPreservesDuplicates proves a scalar array with repeated
+// values (e.g. repeated ports) is not silently deduplicated: each item must
+// be keyed by index rather than by its own value, or a repeated value would
+// overwrite the earlier child sharing that key.
+func TestScalarArrayPreservesDuplicates(t *testing.T) {
+	c := New(WithFormat(FormatJSON))
+	if err := c.InitFromBytes([]byte(`{"a":{"ports":[80,80,443]}}`)); err != nil {
+		t.Fatalf("InitFromBytes: %v", err)
+	}
+
+	got := c.GetDomain("/a/ports")
+	want := []string{"80", "80", "443"}
+	if len(got) != len(want) {
+		t.Fatalf("GetDomain(/a/ports) = %v, want %v", got, want)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("GetDomain(/a/ports)[%d] = %q, want %q", i, got[i], w)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Set creates or overwrites the leaf value at path, creating any
+// intermediate nodes that do not yet exist.
+func (c *Conf) Set(path string, value string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	pathVec := c.root.analysisPath(path)
+	if len(pathVec) == 0 {
+		return
+	}
+	parent := c.root.ensureNode(pathVec[:len(pathVec)-1])
+	leafName := pathVec[len(pathVec)-1]
+	leaf, ok := parent.findChild(leafName)
+	if !ok || !leaf.isLeaf() {
+		leaf = newElem(Leaf, leafName)
+		parent.addChild(leafName, leaf)
+	}
+	leaf.setValue(value)
+}
+
+// SetInt creates or overwrites the leaf value at path with v formatted as
+// a base-10 integer.
+func (c *Conf) SetInt(path string, v int) {
+	c.Set(path, strconv.Itoa(v))
+}
+
+// Delete removes the node or leaf at path, reporting whether it existed.
+func (c *Conf) Delete(path string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	pathVec := c.root.analysisPath(path)
+	if len(pathVec) == 0 {
+		return false
+	}
+	parent, err := c.root.getElem(pathVec[:len(pathVec)-1])
+	if err != nil {
+		return false
+	}
+	return parent.removeChild(pathVec[len(pathVec)-1])
+}
+
+// Marshal reconstructs the XML-with-key=value-leaves TAF format from the
+// in-memory tree in deterministic order: under each node its leaves are
+// written first and its child nodes after, each group in insertion order.
+// Leaves at the root
+// (bare key=value lines with no enclosing tag) are written out the same
+// way the original parser accepts them, before any top-level node.
+func (c *Conf) Marshal() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var buf bytes.Buffer
+	c.root.eachChild(func(child *elem) {
+		if child.isLeaf() {
+			fmt.Fprintf(&buf, "%s=%s\n", child.name, child.value)
+		}
+	})
+	c.root.eachChild(func(child *elem) {
+		if child.isNode() {
+			child.marshal(&buf, 0)
+		}
+	})
+	return buf.Bytes(), nil
+}
+
+// WriteFile marshals Conf and atomically replaces name, writing to a
+// temporary file and renaming it into place so a concurrent Watch reload
+// never observes a half-written file.
+func (c *Conf) WriteFile(name string) error {
+	data, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	tmpName := name + ".tmp"
+	if err := ioutil.WriteFile(tmpName, data, 0644); err != nil {
+		return fmt.Errorf("conf: write temp file %s: %v", tmpName, err)
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		return fmt.Errorf("conf: rename %s to %s: %v", tmpName, name, err)
+	}
+	return nil
+}
+
+func (e *elem) marshal(buf *bytes.Buffer, depth int) {
+	pad := strings.Repeat("\t", depth)
+	fmt.Fprintf(buf, "%s<%s>\n", pad, e.name)
+	leafPad := strings.Repeat("\t", depth+1)
+	e.eachChild(func(child *elem) {
+		if child.isLeaf() {
+			fmt.Fprintf(buf, "%s%s=%s\n", leafPad, child.name, child.value)
+		}
+	})
+	e.eachChild(func(child *elem) {
+		if child.isNode() {
+			child.marshal(buf, depth+1)
+		}
+	})
+	fmt.Fprintf(buf, "%s</%s>\n", pad, e.name)
+}
@@ -0,0 +1,69 @@
+package conf
+
+import (
+	"testing"
+)
+
+// TestMarshalRoundTrip proves that parse -> mutate -> marshal -> parse again
+// yields an equivalent tree, including top-level leaves that have no
+// enclosing tag.
+func TestMarshalRoundTrip(t *testing.T) {
+	c := New()
+	if err := c.InitFromString("toplevel=hello\n<tars>\n\ta=1\n\tb=2\n</tars>\n"); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+
+	if got := c.GetString("toplevel"); got != "hello" {
+		t.Fatalf("before marshal: GetString(toplevel) = %q, want %q", got, "hello")
+	}
+
+	c.Set("/tars<c>", "3")
+
+	data, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	c2 := New()
+	if err := c2.InitFromBytes(data); err != nil {
+		t.Fatalf("InitFromBytes(marshaled): %v\nmarshaled:\n%s", err, data)
+	}
+
+	if got := c2.GetString("toplevel"); got != "hello" {
+		t.Errorf("GetString(toplevel) = %q, want %q (marshaled:\n%s)", got, "hello", data)
+	}
+	if got := c2.GetString("/tars<a>"); got != "1" {
+		t.Errorf("GetString(/tars<a>) = %q, want %q", got, "1")
+	}
+	if got := c2.GetString("/tars<b>"); got != "2" {
+		t.Errorf("GetString(/tars<b>) = %q, want %q", got, "2")
+	}
+	if got := c2.GetString("/tars<c>"); got != "3" {
+		t.Errorf("GetString(/tars<c>) = %q, want %q", got, "3")
+	}
+}
+
+// TestMarshalTopLevelLeafOnly proves a document consisting only of bare
+// top-level leaves (no enclosing tag at all) round-trips correctly.
+func TestMarshalTopLevelLeafOnly(t *testing.T) {
+	c := New()
+	if err := c.InitFromString("a=1\nb=2\n"); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+
+	data, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	c2 := New()
+	if err := c2.InitFromBytes(data); err != nil {
+		t.Fatalf("InitFromBytes(marshaled): %v\nmarshaled:\n%s", err, data)
+	}
+	if got := c2.GetString("a"); got != "1" {
+		t.Errorf("GetString(a) = %q, want %q (marshaled:\n%s)", got, "1", data)
+	}
+	if got := c2.GetString("b"); got != "2" {
+		t.Errorf("GetString(b) = %q, want %q", got, "2")
+	}
+}
@@ -0,0 +1,262 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tagName is the struct tag Unmarshal looks at, e.g. `taf:"ip,default=127.0.0.1"`.
+const tagName = "taf"
+
+// FieldError describes a single field that Unmarshal/UnmarshalPath could not
+// populate, identified by its full config path.
+type FieldError struct {
+	Path   string // full config path, e.g. "/db/master/ip"
+	Reason string // human readable reason, e.g. "missing required value"
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// UnmarshalError collects every FieldError found during a single Unmarshal
+// or UnmarshalPath call, rather than aborting on the first one.
+type UnmarshalError struct {
+	Errors []*FieldError
+}
+
+func (e *UnmarshalError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("conf: unmarshal failed with %d error(s): %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unmarshal populates v, a pointer to a struct, from the root of Conf.
+// It is equivalent to UnmarshalPath("/", v).
+func (c *Conf) Unmarshal(v interface{}) error {
+	return c.UnmarshalPath("/", v)
+}
+
+// UnmarshalPath populates v, a pointer to a struct, from the node at path.
+// Struct fields are matched by a `taf:"name"` tag, falling back to the Go
+// field name. Nested structs correspond to child nodes, map[string]string
+// fields are populated via the node's key=value leaves, []string fields are
+// populated with the names of child nodes, and scalar fields are converted
+// from the leaf value string via strconv (plus time.Duration and time.Time
+// as special cases). A tag may add ",default=<val>" and/or ",required";
+// every missing or malformed field is collected and returned together as
+// an *UnmarshalError rather than aborting on the first one.
+func (c *Conf) UnmarshalPath(path string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("conf: Unmarshal target must be a non-nil pointer to a struct, got %T", v)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	node := c.root
+	if pathVec := c.root.analysisPath(path); len(pathVec) > 0 {
+		var err error
+		node, err = c.root.getElem(pathVec)
+		if err != nil {
+			return &UnmarshalError{Errors: []*FieldError{{Path: path, Reason: "path not found"}}}
+		}
+	}
+
+	var errs []*FieldError
+	unmarshalStruct(node, rv.Elem(), path, &errs)
+	if len(errs) > 0 {
+		return &UnmarshalError{Errors: errs}
+	}
+	return nil
+}
+
+type tafTag struct {
+	name       string
+	hasDefault bool
+	defVal     string
+	required   bool
+}
+
+func parseTafTag(field reflect.StructField) (tafTag, bool) {
+	tag := tafTag{name: field.Name}
+	raw, ok := field.Tag.Lookup(tagName)
+	if !ok {
+		return tag, true
+	}
+	parts := strings.Split(raw, ",")
+	if parts[0] == "-" {
+		return tag, false
+	}
+	if parts[0] != "" {
+		tag.name = parts[0]
+	}
+	for _, opt := range parts[1:] {
+		switch {
+		case opt == "required":
+			tag.required = true
+		case strings.HasPrefix(opt, "default="):
+			tag.hasDefault = true
+			tag.defVal = strings.TrimPrefix(opt, "default=")
+		}
+	}
+	return tag, true
+}
+
+func unmarshalStruct(node *elem, structVal reflect.Value, basePath string, errs *[]*FieldError) {
+	t := structVal.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported field
+		}
+		tag, ok := parseTafTag(field)
+		if !ok {
+			continue
+		}
+		fieldPath := strings.TrimSuffix(basePath, "/") + "/" + tag.name
+		fieldVal := structVal.Field(i)
+		unmarshalField(node, tag, field.Type, fieldVal, fieldPath, errs)
+	}
+}
+
+func unmarshalField(node *elem, tag tafTag, fieldType reflect.Type, fieldVal reflect.Value, fieldPath string, errs *[]*FieldError) {
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		raw := tag.defVal
+		child, ok := node.findChild(tag.name)
+		if ok && child.isLeaf() {
+			raw = child.value
+		} else {
+			if !tag.hasDefault {
+				if tag.required {
+					*errs = append(*errs, &FieldError{Path: fieldPath, Reason: "missing required value"})
+				}
+				return
+			}
+		}
+		ts, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			*errs = append(*errs, &FieldError{Path: fieldPath, Reason: fmt.Sprintf("invalid RFC3339 time %q: %v", raw, err)})
+			return
+		}
+		fieldVal.Set(reflect.ValueOf(ts))
+		return
+	}
+
+	switch fieldType.Kind() {
+	case reflect.Struct:
+		child, ok := node.findChild(tag.name)
+		if !ok || !child.isNode() {
+			if tag.required {
+				*errs = append(*errs, &FieldError{Path: fieldPath, Reason: "missing required section"})
+			}
+			return
+		}
+		unmarshalStruct(child, fieldVal, fieldPath, errs)
+
+	case reflect.Map:
+		if fieldType.Key().Kind() != reflect.String || fieldType.Elem().Kind() != reflect.String {
+			*errs = append(*errs, &FieldError{Path: fieldPath, Reason: "unsupported map type, only map[string]string is supported"})
+			return
+		}
+		child, ok := node.findChild(tag.name)
+		if !ok || !child.isNode() {
+			if tag.required {
+				*errs = append(*errs, &FieldError{Path: fieldPath, Reason: "missing required section"})
+			}
+			return
+		}
+		m := make(map[string]string)
+		child.eachChild(func(grandChild *elem) {
+			if grandChild.isLeaf() {
+				m[grandChild.name] = grandChild.value
+			}
+		})
+		fieldVal.Set(reflect.ValueOf(m))
+
+	case reflect.Slice:
+		if fieldType.Elem().Kind() != reflect.String {
+			*errs = append(*errs, &FieldError{Path: fieldPath, Reason: "unsupported slice type, only []string is supported"})
+			return
+		}
+		child, ok := node.findChild(tag.name)
+		if !ok || !child.isNode() {
+			if tag.required {
+				*errs = append(*errs, &FieldError{Path: fieldPath, Reason: "missing required section"})
+			}
+			return
+		}
+		var domain []string
+		child.eachChild(func(grandChild *elem) {
+			if grandChild.isNode() {
+				domain = append(domain, grandChild.name)
+			}
+		})
+		fieldVal.Set(reflect.ValueOf(domain))
+
+	default:
+		raw := tag.defVal
+		child, ok := node.findChild(tag.name)
+		if ok && child.isLeaf() {
+			raw = child.value
+		} else {
+			if !tag.hasDefault {
+				if tag.required {
+					*errs = append(*errs, &FieldError{Path: fieldPath, Reason: "missing required value"})
+				}
+				return
+			}
+		}
+		if err := setScalar(fieldVal, fieldType, raw); err != nil {
+			*errs = append(*errs, &FieldError{Path: fieldPath, Reason: err.Error()})
+		}
+	}
+}
+
+func setScalar(fieldVal reflect.Value, fieldType reflect.Type, raw string) error {
+	if fieldType == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %v", raw, err)
+		}
+		fieldVal.SetInt(int64(d))
+		return nil
+	}
+	switch fieldType.Kind() {
+	case reflect.String:
+		fieldVal.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, fieldType.Bits())
+		if err != nil {
+			return fmt.Errorf("invalid int %q: %v", raw, err)
+		}
+		fieldVal.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, fieldType.Bits())
+		if err != nil {
+			return fmt.Errorf("invalid uint %q: %v", raw, err)
+		}
+		fieldVal.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, fieldType.Bits())
+		if err != nil {
+			return fmt.Errorf("invalid float %q: %v", raw, err)
+		}
+		fieldVal.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q: %v", raw, err)
+		}
+		fieldVal.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field kind %s", fieldType.Kind())
+	}
+	return nil
+}
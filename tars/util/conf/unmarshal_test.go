@@ -0,0 +1,153 @@
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnmarshalRequiredFieldsAggregateErrors(t *testing.T) {
+	type Sub struct {
+		Missing string `taf:"missing,required"`
+	}
+	type Target struct {
+		MissingScalar string `taf:"missingScalar,required"`
+		MissingSub    Sub    `taf:"missingSub,required"`
+	}
+
+	c := New()
+	if err := c.InitFromString("<tars>\n</tars>\n"); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+
+	var target Target
+	err := c.UnmarshalPath("/tars", &target)
+	if err == nil {
+		t.Fatal("UnmarshalPath: expected an error for missing required fields, got nil")
+	}
+	uerr, ok := err.(*UnmarshalError)
+	if !ok {
+		t.Fatalf("UnmarshalPath: expected *UnmarshalError, got %T", err)
+	}
+	if len(uerr.Errors) != 2 {
+		t.Fatalf("UnmarshalPath: expected 2 aggregated errors, got %d: %v", len(uerr.Errors), uerr.Errors)
+	}
+	if uerr.Errors[0].Path != "/tars/missingScalar" {
+		t.Errorf("Errors[0].Path = %q, want %q", uerr.Errors[0].Path, "/tars/missingScalar")
+	}
+	if uerr.Errors[1].Path != "/tars/missingSub" {
+		t.Errorf("Errors[1].Path = %q, want %q", uerr.Errors[1].Path, "/tars/missingSub")
+	}
+}
+
+func TestUnmarshalTopLevelPathHasSingleLeadingSlash(t *testing.T) {
+	type Target struct {
+		Missing string `taf:"missing,required"`
+	}
+
+	c := New()
+	if err := c.InitFromString("<tars>\n</tars>\n"); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+
+	var target Target
+	err := c.Unmarshal(&target)
+	uerr, ok := err.(*UnmarshalError)
+	if !ok {
+		t.Fatalf("Unmarshal: expected *UnmarshalError, got %T (%v)", err, err)
+	}
+	if got := uerr.Errors[0].Path; got != "/missing" {
+		t.Errorf("Errors[0].Path = %q, want %q", got, "/missing")
+	}
+}
+
+func TestUnmarshalDefaultFallback(t *testing.T) {
+	type Target struct {
+		Timeout string `taf:"timeout,default=30s"`
+	}
+
+	c := New()
+	if err := c.InitFromString("<tars>\n</tars>\n"); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+
+	var target Target
+	if err := c.UnmarshalPath("/tars", &target); err != nil {
+		t.Fatalf("UnmarshalPath: %v", err)
+	}
+	if target.Timeout != "30s" {
+		t.Errorf("Timeout = %q, want %q", target.Timeout, "30s")
+	}
+}
+
+func TestUnmarshalNestedStructMapSlice(t *testing.T) {
+	type DB struct {
+		IP   string `taf:"ip"`
+		Port int    `taf:"port"`
+	}
+	type Target struct {
+		DB      DB                `taf:"db"`
+		Tags    map[string]string `taf:"tags"`
+		Servers []string          `taf:"servers"`
+	}
+
+	c := New()
+	content := "<tars>\n" +
+		"\t<db>\n" +
+		"\t\tip=127.0.0.1\n" +
+		"\t\tport=8080\n" +
+		"\t</db>\n" +
+		"\t<tags>\n" +
+		"\t\tenv=prod\n" +
+		"\t\tregion=us\n" +
+		"\t</tags>\n" +
+		"\t<servers>\n" +
+		"\t\t<a></a>\n" +
+		"\t\t<b></b>\n" +
+		"\t</servers>\n" +
+		"</tars>\n"
+	if err := c.InitFromString(content); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+
+	var target Target
+	if err := c.UnmarshalPath("/tars", &target); err != nil {
+		t.Fatalf("UnmarshalPath: %v", err)
+	}
+	if target.DB.IP != "127.0.0.1" || target.DB.Port != 8080 {
+		t.Errorf("DB = %+v, want {127.0.0.1 8080}", target.DB)
+	}
+	if target.Tags["env"] != "prod" || target.Tags["region"] != "us" {
+		t.Errorf("Tags = %v, want map[env:prod region:us]", target.Tags)
+	}
+	if len(target.Servers) != 2 {
+		t.Fatalf("Servers = %v, want 2 entries", target.Servers)
+	}
+}
+
+func TestUnmarshalDurationAndTime(t *testing.T) {
+	type Target struct {
+		Timeout   time.Duration `taf:"timeout"`
+		StartedAt time.Time     `taf:"startedAt"`
+	}
+
+	c := New()
+	content := "<tars>\n" +
+		"\ttimeout=5s\n" +
+		"\tstartedAt=2024-01-02T15:04:05Z\n" +
+		"</tars>\n"
+	if err := c.InitFromString(content); err != nil {
+		t.Fatalf("InitFromString: %v", err)
+	}
+
+	var target Target
+	if err := c.UnmarshalPath("/tars", &target); err != nil {
+		t.Fatalf("UnmarshalPath: %v", err)
+	}
+	if target.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", target.Timeout)
+	}
+	want, _ := time.Parse(time.RFC3339, "2024-01-02T15:04:05Z")
+	if !target.StartedAt.Equal(want) {
+		t.Errorf("StartedAt = %v, want %v", target.StartedAt, want)
+	}
+}
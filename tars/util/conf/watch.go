@@ -0,0 +1,172 @@
+package conf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces the burst of fsnotify events a single editor save
+// tends to produce (e.g. vim writing a swap file, then the real file).
+const watchDebounce = 200 * time.Millisecond
+
+// NewConfWatched returns a Conf already loaded from fileName with a
+// background Watch goroutine started against a cancelable context. Callers
+// that need to stop watching should use Watch directly instead so they keep
+// the context.CancelFunc.
+func NewConfWatched(fileName string, opts ...Option) (*Conf, error) {
+	c, err := NewConf(fileName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		if err := c.Watch(ctx); err != nil {
+			cancel()
+		}
+	}()
+	return c, nil
+}
+
+// Reload re-reads the file last loaded via InitFromFile (directly or via
+// NewConf/NewConfWatched) and atomically swaps the tree on success. On
+// parse failure Conf is left completely unchanged, and the error is
+// returned to the caller. Safe to call from a SIGHUP handler.
+func (c *Conf) Reload() error {
+	c.mutex.RLock()
+	fileName := c.fileName
+	c.mutex.RUnlock()
+	if fileName == "" {
+		return errors.New("conf: Reload called on a Conf with no source file")
+	}
+	old := c.snapshot()
+	if err := c.InitFromFile(fileName); err != nil {
+		return err
+	}
+	c.notifyChange(old)
+	return nil
+}
+
+// OnChange registers fn to be called with the previous and current Conf
+// whenever Watch or Reload successfully swaps in a new tree. The returned
+// unsubscribe func removes the registration; it is safe to call more than
+// once.
+func (c *Conf) OnChange(fn func(old, new *Conf)) (unsubscribe func()) {
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+	if c.subs == nil {
+		c.subs = make(map[int]func(old *Conf, new *Conf))
+	}
+	id := c.nextSubID
+	c.nextSubID++
+	c.subs[id] = fn
+	return func() {
+		c.subMutex.Lock()
+		defer c.subMutex.Unlock()
+		delete(c.subs, id)
+	}
+}
+
+// snapshot returns a shallow copy of c with its own mutex and no
+// subscribers, used as the "old" value handed to OnChange subscribers. It
+// shares c's current tree, which a reload replaces rather than modifies;
+// Set and Delete on c still modify that shared tree.
+func (c *Conf) snapshot() *Conf {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	cp := *c
+	cp.mutex = new(sync.RWMutex)
+	cp.subs = nil
+	return &cp
+}
+
+func (c *Conf) notifyChange(old *Conf) {
+	c.subMutex.Lock()
+	subs := make([]func(old, new *Conf), 0, len(c.subs))
+	for _, fn := range c.subs {
+		subs = append(subs, fn)
+	}
+	c.subMutex.Unlock()
+	for _, fn := range subs {
+		fn(old, c)
+	}
+}
+
+// Watch observes the file backing Conf (as recorded by InitFromFile) using
+// fsnotify, re-parsing and atomically swapping the tree on Write/Create/
+// Rename events, debounced to coalesce editor saves. It handles vim/emacs
+// rename-based saves by re-establishing the watch after Rename or Remove.
+// A failed reload is dropped without logging: the tree stays as it was and
+// subscribers are not notified; Reload can be called directly if the
+// caller wants the error.
+// Watch blocks until ctx is canceled.
+func (c *Conf) Watch(ctx context.Context) error {
+	c.mutex.RLock()
+	fileName := c.fileName
+	c.mutex.RUnlock()
+	if fileName == "" {
+		return errors.New("conf: Watch called on a Conf with no source file")
+	}
+	dir := filepath.Dir(fileName)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("conf: create watcher: %v", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(dir); err != nil {
+		return fmt.Errorf("conf: watch %s: %v", dir, err)
+	}
+
+	var debounce *time.Timer
+	reload := make(chan struct{}, 1)
+	trigger := func() {
+		if debounce == nil {
+			debounce = time.AfterFunc(watchDebounce, func() {
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
+			})
+			return
+		}
+		debounce.Reset(watchDebounce)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(fileName) {
+				continue
+			}
+			switch {
+			case event.Op&(fsnotify.Write|fsnotify.Create) != 0:
+				trigger()
+			case event.Op&(fsnotify.Rename|fsnotify.Remove) != 0:
+				// editors replace the file via rename/remove, so the inode
+				// watch is gone; re-adding the parent dir watch keeps us
+				// observing the new file at the same path.
+				_ = watcher.Remove(dir)
+				_ = watcher.Add(dir)
+				trigger()
+			}
+		case <-reload:
+			_ = c.Reload()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			_ = err
+		}
+	}
+}
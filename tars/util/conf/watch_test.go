@@ -0,0 +1,99 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentGetWhileReload spams the Get* accessors from goroutines
+// while another goroutine repeatedly rewrites the backing file and calls
+// Reload, to be run with -race: it proves the root swap in Reload/
+// InitFromFile is safe to observe concurrently with reads.
+func TestConcurrentGetWhileReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "watched.conf")
+	if err := os.WriteFile(path, []byte("<tars>\n\ta=1\n</tars>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewConf(path)
+	if err != nil {
+		t.Fatalf("NewConf: %v", err)
+	}
+
+	const rounds = 200
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			content := fmt.Sprintf("<tars>\n\ta=%d\n</tars>\n", i)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Errorf("WriteFile: %v", err)
+				return
+			}
+			if err := c.Reload(); err != nil {
+				t.Errorf("Reload: %v", err)
+				return
+			}
+		}
+	}()
+
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				_ = c.GetString("/tars<a>")
+				_ = c.GetIntWithDef("/tars<a>", -1)
+				_ = c.GetDomain("/tars")
+				_ = c.GetMap("/tars")
+				_ = c.ToString()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// TestOnChangeNotifiedOnReload proves OnChange subscribers see the old and
+// new tree across a Reload.
+func TestOnChangeNotifiedOnReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "watched.conf")
+	if err := os.WriteFile(path, []byte("<tars>\n\ta=1\n</tars>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewConf(path)
+	if err != nil {
+		t.Fatalf("NewConf: %v", err)
+	}
+
+	var mu sync.Mutex
+	var gotOld, gotNew string
+	unsubscribe := c.OnChange(func(old, new *Conf) {
+		mu.Lock()
+		gotOld = old.GetString("/tars<a>")
+		gotNew = new.GetString("/tars<a>")
+		mu.Unlock()
+	})
+	defer unsubscribe()
+
+	if err := os.WriteFile(path, []byte("<tars>\n\ta=2\n</tars>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if gotOld != "1" || gotNew != "2" {
+		t.Errorf("OnChange saw old=%q new=%q, want old=1 new=2", gotOld, gotNew)
+	}
+}